@@ -0,0 +1,245 @@
+package streaming
+
+import (
+	"sync"
+	"time"
+
+	"github.com/francoishill/bitx-go"
+)
+
+// ManagerOnTradeAppliedEvent is OnTradeAppliedEvent with the pair the
+// event occurred on prepended, so a single handler can service many
+// markets.
+type ManagerOnTradeAppliedEvent func(pair, orderID string, price, base float64, isBuy bool, timestamp time.Time)
+
+// ManagerOnOrderCreatedEvent is OnOrderCreatedEvent with the pair the
+// event occurred on prepended.
+type ManagerOnOrderCreatedEvent func(pair, orderID string, price, volume float64, orderType bitx.OrderType, timestamp time.Time)
+
+// ManagerOnOrderDeletedEvent is OnOrderDeletedEvent with the pair the
+// event occurred on prepended.
+type ManagerOnOrderDeletedEvent func(pair, orderID string, price, volume float64, orderType bitx.OrderType, timestamp time.Time)
+
+// SubscribeOptions controls what a Manager-supervised Conn receives and
+// maintains for a pair.
+type SubscribeOptions struct {
+	// DepthLevel limits how many entries OrderBookSnapshot returns per
+	// side; 0 means unlimited. Entries are per order, not per price
+	// level, so several of them may share a price.
+	DepthLevel int
+
+	// Trades, when false, suppresses OnTradeApplied dispatch for this
+	// pair.
+	Trades bool
+
+	// SnapshotOnly, when true, maintains the book from the initial
+	// snapshot only; incremental updates are ignored.
+	SnapshotOnly bool
+}
+
+// DefaultSubscribeOptions is used for any pair added without explicit
+// options, e.g. via NewManager.
+var DefaultSubscribeOptions = SubscribeOptions{Trades: true}
+
+// ConnStatus reports the health of a single pair's connection.
+type ConnStatus struct {
+	LastMessage    time.Time
+	Sequence       int64
+	ReconnectCount int
+	LastError      error
+}
+
+// managedConn pairs a Conn with the bookkeeping a Manager needs to
+// report its health.
+type managedConn struct {
+	conn *Conn
+
+	mu             sync.Mutex
+	opts           SubscribeOptions
+	reconnectCount int
+	lastError      error
+}
+
+// options returns the managedConn's current SubscribeOptions.
+func (mc *managedConn) options() SubscribeOptions {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+	return mc.opts
+}
+
+// setOptions updates the managedConn's SubscribeOptions in place, taking
+// effect on the next event dispatched through conn, without disturbing
+// the running Conn itself.
+func (mc *managedConn) setOptions(opts SubscribeOptions) {
+	mc.mu.Lock()
+	mc.opts = opts
+	mc.mu.Unlock()
+
+	mc.conn.setSnapshotOnly(opts.SnapshotOnly)
+}
+
+// Manager supervises one Conn per pair, sharing credentials and a
+// reconnect/backoff policy, and exposes aggregated, pair-aware APIs
+// across all of them so a caller can run many markets from one process.
+type Manager struct {
+	keyID, keySecret string
+
+	// SnapshotFetcher, if set, is installed on every managed Conn to
+	// enable the buffered-resync path.
+	SnapshotFetcher SnapshotFetcher
+
+	OnTradeApplied ManagerOnTradeAppliedEvent
+	OnOrderCreated ManagerOnOrderCreatedEvent
+	OnOrderDeleted ManagerOnOrderDeletedEvent
+
+	mu    sync.Mutex
+	conns map[string]*managedConn
+}
+
+// NewManager creates a Manager for the given pairs, sharing the supplied
+// credentials and DefaultSubscribeOptions. Call Run to start streaming.
+func NewManager(keyID, keySecret string, pairs []string) *Manager {
+	m := &Manager{
+		keyID:     keyID,
+		keySecret: keySecret,
+		conns:     make(map[string]*managedConn),
+	}
+	for _, pair := range pairs {
+		m.addConn(pair, DefaultSubscribeOptions)
+	}
+	return m
+}
+
+// Subscribe adds pair with opts. If the Manager is already running and
+// pair is new, streaming for it starts immediately; if pair already
+// exists, its existing Conn keeps running and its options are updated
+// in place, taking effect on the next event.
+func (m *Manager) Subscribe(pair string, opts SubscribeOptions) {
+	m.mu.Lock()
+	mc, running := m.conns[pair]
+	m.mu.Unlock()
+
+	if running {
+		mc.setOptions(opts)
+		return
+	}
+
+	mc = m.addConn(pair, opts)
+	go m.supervise(mc)
+}
+
+func (m *Manager) addConn(pair string, opts SubscribeOptions) *managedConn {
+	conn := NewConn(m.keyID, m.keySecret, pair)
+	conn.SnapshotFetcher = m.SnapshotFetcher
+	conn.SnapshotOnly = opts.SnapshotOnly
+
+	mc := &managedConn{conn: conn, opts: opts}
+
+	conn.OnTradeApplied = func(orderID string, price, base float64, isBuy bool, timestamp time.Time) {
+		if !mc.options().Trades || m.OnTradeApplied == nil {
+			return
+		}
+		m.OnTradeApplied(pair, orderID, price, base, isBuy, timestamp)
+	}
+	conn.OnOrderCreated = func(orderID string, price, volume float64, orderType bitx.OrderType, timestamp time.Time) {
+		if m.OnOrderCreated != nil {
+			m.OnOrderCreated(pair, orderID, price, volume, orderType, timestamp)
+		}
+	}
+	conn.OnOrderDeleted = func(orderID string, price, volume float64, orderType bitx.OrderType, timestamp time.Time) {
+		if m.OnOrderDeleted != nil {
+			m.OnOrderDeleted(pair, orderID, price, volume, orderType, timestamp)
+		}
+	}
+
+	m.mu.Lock()
+	m.conns[pair] = mc
+	m.mu.Unlock()
+
+	return mc
+}
+
+// Run starts streaming for every currently subscribed pair and blocks
+// until every connection has been closed.
+func (m *Manager) Run() {
+	m.mu.Lock()
+	mcs := make([]*managedConn, 0, len(m.conns))
+	for _, mc := range m.conns {
+		mcs = append(mcs, mc)
+	}
+	m.mu.Unlock()
+
+	var wg sync.WaitGroup
+	for _, mc := range mcs {
+		wg.Add(1)
+		go func(mc *managedConn) {
+			defer wg.Done()
+			m.supervise(mc)
+		}(mc)
+	}
+	wg.Wait()
+}
+
+func (m *Manager) supervise(mc *managedConn) {
+	mc.conn.SnapshotFetcher = m.SnapshotFetcher
+	mc.conn.ManageForever(func(err error) {
+		mc.mu.Lock()
+		mc.reconnectCount++
+		mc.lastError = err
+		mc.mu.Unlock()
+	})
+}
+
+// OrderBookSnapshot returns the latest order book for pair, truncated to
+// its SubscribeOptions.DepthLevel if set. ok is false if pair is not
+// subscribed.
+func (m *Manager) OrderBookSnapshot(pair string) (seq int64, bids, asks []bitx.OrderBookEntry, ok bool) {
+	mc := m.get(pair)
+	if mc == nil {
+		return 0, nil, nil, false
+	}
+
+	seq, bids, asks = mc.conn.OrderBookSnapshot()
+	if depth := mc.options().DepthLevel; depth > 0 {
+		if len(bids) > depth {
+			bids = bids[:depth]
+		}
+		if len(asks) > depth {
+			asks = asks[:depth]
+		}
+	}
+	return seq, bids, asks, true
+}
+
+// Status reports the health of pair's connection. ok is false if pair is
+// not subscribed.
+func (m *Manager) Status(pair string) (status ConnStatus, ok bool) {
+	mc := m.get(pair)
+	if mc == nil {
+		return ConnStatus{}, false
+	}
+
+	mc.mu.Lock()
+	status.ReconnectCount = mc.reconnectCount
+	status.LastError = mc.lastError
+	mc.mu.Unlock()
+
+	status.Sequence = mc.conn.OrderBookSeq()
+	status.LastMessage = mc.conn.LastMessage()
+	return status, true
+}
+
+func (m *Manager) get(pair string) *managedConn {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.conns[pair]
+}
+
+// Close closes every pair's connection.
+func (m *Manager) Close() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, mc := range m.conns {
+		mc.conn.Close()
+	}
+}
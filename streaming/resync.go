@@ -0,0 +1,180 @@
+package streaming
+
+import (
+	"errors"
+	"log"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/francoishill/bitx-go"
+)
+
+// DefaultResyncBufferSize is the default ResyncBufferSize used by NewConn.
+const DefaultResyncBufferSize = 1000
+
+// DefaultResyncTimeout is the default ResyncTimeout used by NewConn.
+const DefaultResyncTimeout = 30 * time.Second
+
+// SnapshotFetcher fetches a fresh order book snapshot for a pair, used to
+// reseed a Conn after a sequence gap is detected in the update stream.
+type SnapshotFetcher interface {
+	OrderBook(pair string) (*bitx.OrderBook, error)
+}
+
+// clientSnapshotFetcher is the default SnapshotFetcher, backed by the
+// regular bitx REST API.
+type clientSnapshotFetcher struct {
+	client *bitx.Client
+}
+
+// NewSnapshotFetcher returns a SnapshotFetcher that fetches snapshots via
+// client.OrderBook.
+func NewSnapshotFetcher(client *bitx.Client) SnapshotFetcher {
+	return &clientSnapshotFetcher{client: client}
+}
+
+func (f *clientSnapshotFetcher) OrderBook(pair string) (*bitx.OrderBook, error) {
+	return f.client.OrderBook(pair)
+}
+
+// startResync transitions c into the resyncing state and kicks off a
+// goroutine to fetch a replacement snapshot. c.mu must be held by the
+// caller.
+func (c *Conn) startResync() {
+	if c.resyncing {
+		return
+	}
+	c.resyncing = true
+	c.resyncBuffer = make(map[int64]update)
+	c.resyncStarted = time.Now()
+	c.resyncGen++
+	gen := c.resyncGen
+
+	go c.fetchResyncSnapshot(gen)
+}
+
+// bufferForResync queues u while a resync is in progress, failing once the
+// buffer overflows or the resync has taken too long so the caller can force
+// a full reconnect. c.mu must be held by the caller.
+func (c *Conn) bufferForResync(u update) error {
+	if time.Since(c.resyncStarted) > c.resyncTimeout() {
+		return errors.New("bitx-go/streaming: timed out waiting for resync snapshot")
+	}
+	if len(c.resyncBuffer) >= c.resyncBufferSize() {
+		return errors.New("bitx-go/streaming: resync buffer overflow")
+	}
+
+	c.resyncBuffer[u.Sequence] = u
+	c.lastMessage = time.Now()
+	return nil
+}
+
+func (c *Conn) resyncBufferSize() int {
+	if c.ResyncBufferSize > 0 {
+		return c.ResyncBufferSize
+	}
+	return DefaultResyncBufferSize
+}
+
+func (c *Conn) resyncTimeout() time.Duration {
+	if c.ResyncTimeout > 0 {
+		return c.ResyncTimeout
+	}
+	return DefaultResyncTimeout
+}
+
+// fetchResyncSnapshot fetches a replacement order book snapshot and, once
+// it arrives, replays any updates buffered in the meantime. gen is the
+// resyncGen this resync was started under, used by applyResyncSnapshot
+// to detect and discard a result that's been superseded by a later
+// resync.
+func (c *Conn) fetchResyncSnapshot(gen int64) {
+	if c.SnapshotFetcher == nil {
+		log.Printf("bitx-go/streaming: no SnapshotFetcher configured, cannot resync key=%s pair=%s", c.keyID, c.pair)
+		return
+	}
+
+	ob, err := c.SnapshotFetcher.OrderBook(c.pair)
+	if err != nil {
+		log.Printf("bitx-go/streaming: resync snapshot fetch failed key=%s pair=%s: %+v", c.keyID, c.pair, err)
+		return
+	}
+
+	c.applyResyncSnapshot(ob, gen)
+}
+
+// applyResyncSnapshot adopts ob as the new order book and replays any
+// updates that were buffered while the snapshot was in flight. gen must
+// still match c.resyncGen, or this resync has been superseded (e.g. a
+// reconnect orphaned it and a newer resync is now in flight) and ob is
+// discarded rather than applied over the wrong resync's state.
+func (c *Conn) applyResyncSnapshot(ob *bitx.OrderBook, gen int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.resyncing || gen != c.resyncGen {
+		// Either a reconnect happened while the snapshot was in flight,
+		// or a newer resync has since superseded this one; discard it.
+		return
+	}
+
+	// Snapshot liquidity becomes the new bidBaseline/askBaseline (see
+	// that doc for why it can't be folded into c.bids/c.asks directly).
+	// Any live per-order state from before the gap is dropped: we have
+	// no way to tell which of it is still reflected in the new
+	// snapshot, so keeping it risks double counting.
+	bidBaseline := make(map[string]float64, len(ob.Bids))
+	for _, e := range ob.Bids {
+		bidBaseline[snapshotEntryKey(e)] = e.Volume
+	}
+	askBaseline := make(map[string]float64, len(ob.Asks))
+	for _, e := range ob.Asks {
+		askBaseline[snapshotEntryKey(e)] = e.Volume
+	}
+	c.bids = make(map[string]order)
+	c.asks = make(map[string]order)
+	c.bidBaseline = bidBaseline
+	c.askBaseline = askBaseline
+	c.seq = ob.Sequence
+
+	buffered := c.resyncBuffer
+	c.resyncBuffer = nil
+	c.resyncing = false
+
+	seqs := make([]int64, 0, len(buffered))
+	for seq := range buffered {
+		seqs = append(seqs, seq)
+	}
+	sort.Slice(seqs, func(i, j int) bool { return seqs[i] < seqs[j] })
+
+	for _, seq := range seqs {
+		u := buffered[seq]
+		if u.Sequence <= c.seq {
+			// Stale relative to the snapshot we just took; discard it.
+			continue
+		}
+		if u.Sequence != c.seq+1 {
+			// The buffer doesn't reach back to the snapshot; applying
+			// across the gap would corrupt the book, so start over.
+			log.Printf("bitx-go/streaming: buffered updates do not follow resync snapshot key=%s pair=%s: have=%d got=%d", c.keyID, c.pair, c.seq, u.Sequence)
+			c.startResync()
+			return
+		}
+		if err := c.applyUpdate(u); err != nil {
+			log.Printf("bitx-go/streaming: failed to replay buffered update key=%s pair=%s: %+v", c.keyID, c.pair, err)
+			c.startResync()
+			return
+		}
+	}
+
+	c.lastMessage = time.Now()
+	log.Printf("bitx-go/streaming: resynced from snapshot key=%s pair=%s seq=%d", c.keyID, c.pair, c.seq)
+}
+
+// snapshotEntryKey derives a bidBaseline/askBaseline key for a REST order
+// book entry (see the Conn.bidBaseline/askBaseline doc): it is a price,
+// not an order ID, and must never be treated as one.
+func snapshotEntryKey(e bitx.OrderBookEntry) string {
+	return strconv.FormatFloat(e.Price, 'f', -1, 64)
+}
@@ -16,6 +16,7 @@ Example:
 package streaming
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"flag"
@@ -23,17 +24,26 @@ import (
 	"log"
 	"math/rand"
 	"sort"
+	"strconv"
 	"sync"
 	"time"
 
 	"github.com/francoishill/bitx-go"
-	"golang.org/x/net/websocket"
+	"github.com/gorilla/websocket"
 )
 
 var (
 	wsHost = flag.String("luno_websocket_host", "wss://ws.luno.com", "Luno API websocket host")
 )
 
+// DefaultPingInterval is the default PingInterval used by NewConn.
+const DefaultPingInterval = time.Minute
+
+// DefaultPongWait is the default PongWait used by NewConn. It must be
+// comfortably longer than PingInterval so a single dropped pong does not
+// tear down a healthy connection.
+const DefaultPongWait = 3 * time.Minute
+
 func convertOrders(ol []*order) (map[string]order, error) {
 	r := make(map[string]order)
 	for _, o := range ol {
@@ -82,6 +92,31 @@ func flatten(m map[string]order, reverse bool) []bitx.OrderBookEntry {
 	return ol
 }
 
+// combineLevels merges baseline (see the Conn.bidBaseline/askBaseline
+// doc) into live. live's entries are kept under their real order ID
+// unchanged, so distinct live orders are never collapsed into each
+// other even when they share a price; baseline entries, which have no
+// order ID of their own, are added alongside them under a synthetic key
+// derived from price instead.
+func combineLevels(live map[string]order, baseline map[string]float64) map[string]order {
+	if len(baseline) == 0 {
+		return live
+	}
+
+	levels := make(map[string]order, len(live)+len(baseline))
+	for id, o := range live {
+		levels[id] = o
+	}
+	for priceKey, volume := range baseline {
+		price, err := strconv.ParseFloat(priceKey, 64)
+		if err != nil {
+			continue
+		}
+		levels["baseline:"+priceKey] = order{Price: price, Volume: volume}
+	}
+	return levels
+}
+
 type OrderBookEntryGroup struct {
 	Price, Volume float64
 	Count         int64
@@ -132,15 +167,87 @@ type Conn struct {
 	keyID, keySecret string
 	pair             string
 
-	ws     *websocket.Conn
+	ws     WSConn
 	closed bool
 
 	seq  int64
 	bids map[string]order
 	asks map[string]order
 
+	// bidBaseline and askBaseline hold liquidity recovered from a REST
+	// resync snapshot, keyed by price (see snapshotEntryKey) rather than
+	// by order ID: unlike the streaming feed, a REST order book carries
+	// no per-order IDs, so this volume can never be attributed to a
+	// trackable order, and is instead carried as anonymous per-price
+	// volume until the next resync or reconnect replaces it; trades and
+	// deletes, which name an order ID, are not applied to it. combineLevels merges it
+	// into the live, per-order bids/asks for every reader (flatten,
+	// OrderBookSnapshot, isValidLocked) to see.
+	bidBaseline map[string]float64
+	askBaseline map[string]float64
+
 	lastMessage time.Time
 
+	// resyncing is true while the Conn is waiting for a fresh order book
+	// snapshot to recover from a sequence gap. While set, incoming
+	// updates are buffered in resyncBuffer rather than applied directly.
+	resyncing     bool
+	resyncBuffer  map[int64]update
+	resyncStarted time.Time
+
+	// resyncGen counts how many resyncs have been started, so a
+	// fetchResyncSnapshot goroutine from an earlier, now-superseded
+	// resync (e.g. one orphaned by a reconnect) can recognize that and
+	// discard its result instead of applying it over a newer resync's
+	// state. See startResync/applyResyncSnapshot.
+	resyncGen int64
+
+	// SnapshotFetcher is used to fetch a fresh order book snapshot when
+	// a sequence gap is detected. If nil, a gap forces a full reconnect
+	// as before. Defaults to nil; set NewSnapshotFetcher's result to
+	// enable buffered resync.
+	SnapshotFetcher SnapshotFetcher
+
+	// ResyncBufferSize is the maximum number of updates buffered while
+	// waiting for a resync snapshot before giving up and reconnecting.
+	// Defaults to DefaultResyncBufferSize.
+	ResyncBufferSize int
+
+	// ResyncTimeout is how long to wait for a resync snapshot before
+	// giving up and reconnecting. Defaults to DefaultResyncTimeout.
+	ResyncTimeout time.Duration
+
+	// PingInterval is how often a ping control frame is sent to the
+	// server. Defaults to DefaultPingInterval.
+	PingInterval time.Duration
+
+	// PongWait is how long to wait for a pong or ping from the server
+	// before treating the connection as dead. The read deadline is
+	// extended on every pong or ping received; other messages do not
+	// extend it. Defaults to DefaultPongWait.
+	PongWait time.Duration
+
+	// VerifyInterval is how often the maintained book is checked for
+	// corruption. Defaults to DefaultVerifyInterval.
+	VerifyInterval time.Duration
+
+	// VerifyChecksum is an optional hook, installed by the caller, that
+	// validates a protocol-level checksum (e.g. Luno's periodic
+	// checksum message) against the currently maintained book. If it
+	// returns an error, the book is treated as corrupt and a resync is
+	// forced via the buffered-resync path.
+	VerifyChecksum func(bids, asks []bitx.OrderBookEntry, seq int64) error
+
+	// SnapshotOnly, when true, maintains the book from the initial
+	// snapshot only and ignores incremental updates. Used by Manager to
+	// implement SubscribeOptions.SnapshotOnly.
+	SnapshotOnly bool
+
+	// Dialer opens the websocket connection used by connect. Defaults to
+	// DefaultDialer; tests substitute a streamingtest.Dialer to script
+	// connection behaviour without a real network connection.
+	Dialer Dialer
+
 	OnTradeApplied OnTradeAppliedEvent
 	OnOrderCreated OnOrderCreatedEvent
 	OnOrderDeleted OnOrderDeletedEvent
@@ -151,10 +258,28 @@ type Conn struct {
 // NewConn initiates a connection to the streaming service for the given market pair
 func NewConn(keyID, keySecret, pair string) *Conn {
 	return &Conn{
-		keyID:     keyID,
-		keySecret: keySecret,
-		pair:      pair,
+		keyID:            keyID,
+		keySecret:        keySecret,
+		pair:             pair,
+		ResyncBufferSize: DefaultResyncBufferSize,
+		ResyncTimeout:    DefaultResyncTimeout,
+		PingInterval:     DefaultPingInterval,
+		PongWait:         DefaultPongWait,
+	}
+}
+
+func (c *Conn) pingInterval() time.Duration {
+	if c.PingInterval > 0 {
+		return c.PingInterval
 	}
+	return DefaultPingInterval
+}
+
+func (c *Conn) pongWait() time.Duration {
+	if c.PongWait > 0 {
+		return c.PongWait
+	}
+	return DefaultPongWait
 }
 
 // ManageForever starts processing data for the connection.
@@ -198,7 +323,7 @@ func (c *Conn) ManageForever(onConnectionError func(err error)) {
 
 func (c *Conn) connect() error {
 	url := *wsHost + "/api/1/stream/" + c.pair
-	ws, err := websocket.Dial(url, "", "http://localhost/")
+	ws, err := c.dialer().Dial(context.Background(), url)
 	if err != nil {
 		return err
 	}
@@ -209,6 +334,10 @@ func (c *Conn) connect() error {
 		c.seq = 0
 		c.bids = nil
 		c.asks = nil
+		c.bidBaseline = nil
+		c.askBaseline = nil
+		c.resyncing = false
+		c.resyncBuffer = nil
 		c.mu.Unlock()
 	}()
 
@@ -221,18 +350,30 @@ func (c *Conn) connect() error {
 		c.mu.Unlock()
 	}
 
+	ws.SetReadDeadline(time.Now().Add(c.pongWait()))
+	ws.SetPongHandler(func(string) error {
+		c.receivedPing()
+		ws.SetReadDeadline(time.Now().Add(c.pongWait()))
+		return nil
+	})
+	ws.SetPingHandler(func(data string) error {
+		c.receivedPing()
+		ws.SetReadDeadline(time.Now().Add(c.pongWait()))
+		return ws.WriteControl(websocket.PongMessage, []byte(data), time.Now().Add(10*time.Second))
+	})
+
 	cred := credentials{c.keyID, c.keySecret}
-	if err := websocket.JSON.Send(ws, cred); err != nil {
+	if err := ws.WriteJSON(cred); err != nil {
 		return err
 	}
 
 	log.Printf("bitx-go/streaming: Connection established key=%s pair=%s", c.keyID, c.pair)
 
-	go sendPings(ws)
+	go c.sendPings(ws)
+	go c.verifyLoop(ws)
 
 	for {
-		var data []byte
-		err := websocket.Message.Receive(c.ws, &data)
+		_, data, err := ws.ReadMessage()
 		if err != nil {
 			return err
 		}
@@ -264,13 +405,19 @@ func (c *Conn) connect() error {
 	}
 }
 
-func sendPings(ws *websocket.Conn) {
+// sendPings periodically writes a real WebSocket ping control frame to ws.
+// It closes ws on any write failure, which causes connect's read loop to
+// return an error and ManageForever to reconnect.
+func (c *Conn) sendPings(ws WSConn) {
 	defer ws.Close()
-	for {
-		if err := websocket.Message.Send(ws, ""); err != nil {
+
+	ticker := time.NewTicker(c.pingInterval())
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if err := ws.WriteControl(websocket.PingMessage, nil, time.Now().Add(10*time.Second)); err != nil {
 			return
 		}
-		time.Sleep(time.Minute)
 	}
 }
 
@@ -310,14 +457,33 @@ func (c *Conn) receivedUpdate(u update) error {
 		return nil
 	}
 
+	if c.SnapshotOnly {
+		return nil
+	}
+
+	if c.resyncing {
+		return c.bufferForResync(u)
+	}
+
 	if u.Sequence <= c.seq {
 		// Old update. We can just discard it.
 		return nil
 	}
 	if u.Sequence != c.seq+1 {
-		return errors.New("update received out of sequence")
+		log.Printf("bitx-go/streaming: sequence gap key=%s pair=%s: have=%d got=%d", c.keyID, c.pair, c.seq, u.Sequence)
+		if c.SnapshotFetcher == nil {
+			return errors.New("update received out of sequence")
+		}
+		c.startResync()
+		return c.bufferForResync(u)
 	}
 
+	return c.applyUpdate(u)
+}
+
+// applyUpdate applies an update that is already known to directly follow
+// c.seq. c.mu must be held by the caller.
+func (c *Conn) applyUpdate(u update) error {
 	timestamp := time.Unix(0, u.Timestamp*1e6)
 
 	// Process trades
@@ -400,7 +566,16 @@ func (c *Conn) processTrade(t tradeUpdate, timestamp time.Time) error {
 		return nil
 	}
 
-	return errors.New("trade for unknown order")
+	// The order isn't one we're tracking individually, most likely
+	// because it's pre-resync baseline volume (see bidBaseline/
+	// askBaseline) rather than a trackable order, so it can't be
+	// decremented by this trade. Treating that as a connection error
+	// here would force exactly the reconnect the buffered-resync path
+	// exists to avoid; the baseline is instead replaced by the next
+	// resync (such as one verifyLoop forces when IsValid fails) or
+	// reconnect.
+	log.Printf("bitx-go/streaming: trade for untracked order key=%s pair=%s orderID=%s", c.keyID, c.pair, t.OrderID)
+	return nil
 }
 
 func (c *Conn) processCreate(u createUpdate, timestamp time.Time) error {
@@ -426,23 +601,41 @@ func (c *Conn) processCreate(u createUpdate, timestamp time.Time) error {
 }
 
 func (c *Conn) processDelete(u deleteUpdate, timestamp time.Time) error {
-	if b, ok := c.bids[u.OrderID]; ok {
+	b, bok := c.bids[u.OrderID]
+	if bok {
 		if c.OnOrderDeleted != nil {
 			defer c.OnOrderDeleted(u.OrderID, b.Price, b.Volume, bitx.BID, timestamp)
 		}
 	}
-	if a, ok := c.asks[u.OrderID]; ok {
+	a, aok := c.asks[u.OrderID]
+	if aok {
 		if c.OnOrderDeleted != nil {
 			defer c.OnOrderDeleted(u.OrderID, a.Price, a.Volume, bitx.ASK, timestamp)
 		}
 	}
 
+	if !bok && !aok {
+		// As in processTrade: most likely pre-resync baseline volume,
+		// which a delete by ID alone can't resolve to a price level.
+		// Left in the baseline until the next resync or reconnect
+		// replaces it, rather than treated as an error.
+		log.Printf("bitx-go/streaming: delete for untracked order key=%s pair=%s orderID=%s", c.keyID, c.pair, u.OrderID)
+	}
+
 	delete(c.bids, u.OrderID)
 	delete(c.asks, u.OrderID)
 
 	return nil
 }
 
+// setSnapshotOnly updates SnapshotOnly while the Conn may already be
+// running, used by Manager to apply a re-Subscribe in place.
+func (c *Conn) setSnapshotOnly(v bool) {
+	c.mu.Lock()
+	c.SnapshotOnly = v
+	c.mu.Unlock()
+}
+
 // OrderBookSeq returns the latest order book sequence.
 func (c *Conn) OrderBookSeq() int64 {
 	c.mu.Lock()
@@ -450,13 +643,21 @@ func (c *Conn) OrderBookSeq() int64 {
 	return c.seq
 }
 
+// LastMessage returns the time of the last message received on the
+// connection, whether a ping, order book snapshot, or update.
+func (c *Conn) LastMessage() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.lastMessage
+}
+
 // OrderBookSnapshot returns the latest order book.
 func (c *Conn) OrderBookSnapshot() (int64, []bitx.OrderBookEntry, []bitx.OrderBookEntry) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
-	bids := flatten(c.bids, true)
-	asks := flatten(c.asks, false)
+	bids := flatten(combineLevels(c.bids, c.bidBaseline), true)
+	asks := flatten(combineLevels(c.asks, c.askBaseline), false)
 	return c.seq, bids, asks
 }
 
@@ -465,8 +666,8 @@ func (c *Conn) OrderBookSnapshotGroupByPriceSumVolume() (int64, []OrderBookEntry
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
-	bids := flattenGroupByPriceSumVolume(c.bids, true)
-	asks := flattenGroupByPriceSumVolume(c.asks, false)
+	bids := flattenGroupByPriceSumVolume(combineLevels(c.bids, c.bidBaseline), true)
+	asks := flattenGroupByPriceSumVolume(combineLevels(c.asks, c.askBaseline), false)
 	return c.seq, bids, asks
 }
 
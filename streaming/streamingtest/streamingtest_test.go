@@ -0,0 +1,195 @@
+package streamingtest_test
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/francoishill/bitx-go"
+	"github.com/francoishill/bitx-go/streaming"
+	"github.com/francoishill/bitx-go/streaming/streamingtest"
+)
+
+// fakeSnapshotFetcher stands in for a REST call during resync.
+type fakeSnapshotFetcher struct {
+	ob *bitx.OrderBook
+}
+
+func (f fakeSnapshotFetcher) OrderBook(pair string) (*bitx.OrderBook, error) {
+	return f.ob, nil
+}
+
+func TestSequenceGapBuffersAndResyncs(t *testing.T) {
+	dialer := streamingtest.NewDialer(streamingtest.Script{
+		Messages: []interface{}{
+			streamingtest.Snapshot(1, nil, nil),
+			streamingtest.Update(2),
+			streamingtest.Update(4), // gap: sequence 3 never arrives
+		},
+	})
+
+	c := streaming.NewConn("key", "secret", "XBTZAR")
+	c.Dialer = dialer
+	c.SnapshotFetcher = fakeSnapshotFetcher{ob: &bitx.OrderBook{Sequence: 3}}
+
+	go c.ManageForever(nil)
+	defer c.Close()
+
+	deadline := time.After(2 * time.Second)
+	for c.OrderBookSeq() != 4 {
+		select {
+		case <-deadline:
+			t.Fatalf("resync never completed, seq=%d", c.OrderBookSeq())
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+}
+
+func TestDropAfterReportsErrorAndBacksOff(t *testing.T) {
+	dialer := streamingtest.NewDialer(
+		streamingtest.Script{
+			Messages:  []interface{}{streamingtest.Snapshot(1, nil, nil)},
+			DropAfter: 1,
+		},
+		streamingtest.Script{
+			Messages: []interface{}{streamingtest.Snapshot(2, nil, nil)},
+		},
+	)
+
+	c := streaming.NewConn("key", "secret", "XBTZAR")
+	c.Dialer = dialer
+
+	errs := make(chan error, 1)
+	go c.ManageForever(func(err error) {
+		select {
+		case errs <- err:
+		default:
+		}
+	})
+	defer c.Close()
+
+	select {
+	case err := <-errs:
+		if err == nil {
+			t.Fatal("expected ManageForever to report the dropped connection")
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("expected a connection error after DropAfter")
+	}
+
+	if got := dialer.Dials(); got != 1 {
+		t.Fatalf("dials = %d, want 1 (second attempt is backed off)", got)
+	}
+}
+
+func TestReadErrAfterReportsError(t *testing.T) {
+	dialer := streamingtest.NewDialer(streamingtest.Script{
+		Messages:     []interface{}{streamingtest.Snapshot(1, nil, nil)},
+		ReadErrAfter: 1,
+	})
+
+	c := streaming.NewConn("key", "secret", "XBTZAR")
+	c.Dialer = dialer
+
+	errs := make(chan error, 1)
+	go c.ManageForever(func(err error) {
+		select {
+		case errs <- err:
+		default:
+		}
+	})
+	defer c.Close()
+
+	select {
+	case err := <-errs:
+		if err == nil {
+			t.Fatal("expected ManageForever to report the injected read error")
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("expected a connection error after ReadErrAfter")
+	}
+}
+
+func TestCloseWhileConnectedStopsManageForever(t *testing.T) {
+	dialer := streamingtest.NewDialer(streamingtest.Script{
+		Messages: []interface{}{streamingtest.Snapshot(1, nil, nil)},
+	})
+
+	c := streaming.NewConn("key", "secret", "XBTZAR")
+	c.Dialer = dialer
+
+	done := make(chan struct{})
+	go func() {
+		c.ManageForever(nil)
+		close(done)
+	}()
+
+	deadline := time.After(2 * time.Second)
+	for c.OrderBookSeq() != 1 {
+		select {
+		case <-deadline:
+			t.Fatal("connection never became ready")
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+
+	// Close races an active, idle connection rather than a reconnect
+	// backoff sleep: ManageForever checks c.closed only at the top of
+	// its loop, so closing mid-sleep wouldn't return promptly. Closing
+	// while connected must unblock the read loop and return without
+	// waiting on a dial.
+	c.Close()
+
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("ManageForever did not return promptly after Close")
+	}
+}
+
+func TestManageForeverBackoffGrows(t *testing.T) {
+	if testing.Short() {
+		t.Skip("backoff progression takes tens of seconds; skipped with -short")
+	}
+
+	script := streamingtest.Script{
+		Messages:  []interface{}{streamingtest.Snapshot(1, nil, nil)},
+		DropAfter: 1,
+	}
+	dialer := streamingtest.NewDialer(script, script, script)
+
+	c := streaming.NewConn("key", "secret", "XBTZAR")
+	c.Dialer = dialer
+
+	var mu sync.Mutex
+	var attempts []time.Time
+	go c.ManageForever(func(err error) {
+		mu.Lock()
+		attempts = append(attempts, time.Now())
+		mu.Unlock()
+	})
+	defer c.Close()
+
+	deadline := time.After(90 * time.Second)
+	for {
+		mu.Lock()
+		n := len(attempts)
+		mu.Unlock()
+		if n >= 3 {
+			break
+		}
+		select {
+		case <-deadline:
+			t.Fatalf("expected 3 reconnect attempts, got %d", n)
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	gap1 := attempts[1].Sub(attempts[0])
+	gap2 := attempts[2].Sub(attempts[1])
+	if gap2 <= gap1 {
+		t.Fatalf("expected backoff to grow between attempts, gap1=%s gap2=%s", gap1, gap2)
+	}
+}
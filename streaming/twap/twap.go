@@ -0,0 +1,372 @@
+/*
+Package twap implements a TWAP (time-weighted average price) execution
+strategy on top of a streaming.Conn order book, patterned after bbgo's
+twap.Execution.
+
+Example:
+
+	exec := twap.NewTwapExecution(conn, client, "XBTZAR", twap.Buy, 1.0, 0.05, 0)
+	go exec.Run(ctx)
+	<-exec.Done()
+	log.Printf("%+v", exec.Stats())
+*/
+package twap
+
+import (
+	"context"
+	"errors"
+	"log"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/francoishill/bitx-go"
+	"github.com/francoishill/bitx-go/streaming"
+	"golang.org/x/time/rate"
+)
+
+// Side is the direction of the parent order being worked.
+type Side string
+
+const (
+	Buy  Side = "BUY"
+	Sell Side = "SELL"
+)
+
+// DefaultUpdateInterval is the default UpdateInterval used by
+// NewTwapExecution.
+const DefaultUpdateInterval = 5 * time.Second
+
+// DefaultRepegTicks is the default RepegTicks used by NewTwapExecution.
+const DefaultRepegTicks = 2.0
+
+// DefaultTickSize is the TickSize used by NewTwapExecution when none is
+// set.
+const DefaultTickSize = 1.0
+
+// Stats reports the progress of a TwapExecution.
+type Stats struct {
+	FilledQuantity    float64
+	AveragePrice      float64
+	RemainingQuantity float64
+}
+
+// TwapExecution slices a parent order into small child orders posted at
+// the top of book. It uses a streaming.Conn as its live price source and
+// a bitx.Client to place and cancel the child orders, listening to the
+// Conn's OnTradeApplied/OnOrderDeleted events to know when its own
+// orders fill, and re-pegs the outstanding child order whenever the
+// best price on its side moves by more than RepegTicks.
+type TwapExecution struct {
+	Conn   *streaming.Conn
+	Client *bitx.Client
+
+	Symbol         string
+	Side           Side
+	TargetQuantity float64
+	SliceQuantity  float64
+	PriceLimit     float64
+	UpdateInterval time.Duration
+	RepegTicks     float64
+	TickSize       float64
+
+	// Limiter rate-limits order placement/cancellation to stay under
+	// Luno's API limits. Defaults to one request per second.
+	Limiter *rate.Limiter
+
+	mu             sync.Mutex
+	filled         float64
+	filledNotional float64
+	activeOrderID  string
+	activePrice    float64
+	lastErr        error
+	cancelFunc     context.CancelFunc
+
+	done chan struct{}
+}
+
+// NewTwapExecution creates a TwapExecution with sane defaults for
+// UpdateInterval, RepegTicks and rate limiting.
+func NewTwapExecution(conn *streaming.Conn, client *bitx.Client, symbol string, side Side, targetQuantity, sliceQuantity, priceLimit float64) *TwapExecution {
+	return &TwapExecution{
+		Conn:           conn,
+		Client:         client,
+		Symbol:         symbol,
+		Side:           side,
+		TargetQuantity: targetQuantity,
+		SliceQuantity:  sliceQuantity,
+		PriceLimit:     priceLimit,
+		UpdateInterval: DefaultUpdateInterval,
+		RepegTicks:     DefaultRepegTicks,
+		Limiter:        rate.NewLimiter(rate.Every(time.Second), 1),
+		done:           make(chan struct{}),
+	}
+}
+
+// Run drives the execution until ctx is cancelled, the target quantity
+// is filled, or Cancel is called. It wraps whatever OnTradeApplied and
+// OnOrderDeleted handlers are already installed on Conn for the
+// duration, calling through to them first, so another consumer of the
+// same Conn (e.g. a streaming.Manager) keeps receiving events; the
+// previous handlers are restored once Run returns.
+func (t *TwapExecution) Run(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
+	t.mu.Lock()
+	t.cancelFunc = cancel
+	t.mu.Unlock()
+	defer close(t.done)
+
+	prevOnTradeApplied := t.Conn.OnTradeApplied
+	prevOnOrderDeleted := t.Conn.OnOrderDeleted
+	t.Conn.OnTradeApplied = func(orderID string, price, base float64, isBuy bool, timestamp time.Time) {
+		if prevOnTradeApplied != nil {
+			prevOnTradeApplied(orderID, price, base, isBuy, timestamp)
+		}
+		t.onTradeApplied(orderID, price, base, isBuy, timestamp)
+	}
+	t.Conn.OnOrderDeleted = func(orderID string, price, volume float64, orderType bitx.OrderType, timestamp time.Time) {
+		if prevOnOrderDeleted != nil {
+			prevOnOrderDeleted(orderID, price, volume, orderType, timestamp)
+		}
+		t.onOrderDeleted(orderID, price, volume, orderType, timestamp)
+	}
+	defer func() {
+		t.Conn.OnTradeApplied = prevOnTradeApplied
+		t.Conn.OnOrderDeleted = prevOnOrderDeleted
+	}()
+
+	ticker := time.NewTicker(t.updateInterval())
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			t.cancelOutstanding()
+			if err := ctx.Err(); err != context.Canceled {
+				return err
+			}
+			return nil
+		case <-ticker.C:
+			if t.isComplete() {
+				t.cancelOutstanding()
+				return nil
+			}
+			if err := t.tick(ctx); err != nil {
+				t.mu.Lock()
+				t.lastErr = err
+				t.mu.Unlock()
+				log.Printf("bitx-go/streaming/twap: tick error symbol=%s: %+v", t.Symbol, err)
+			}
+		}
+	}
+}
+
+// Done returns a channel that is closed once Run returns.
+func (t *TwapExecution) Done() <-chan struct{} {
+	return t.done
+}
+
+// Cancel stops Run and pulls any outstanding child order.
+func (t *TwapExecution) Cancel() {
+	t.mu.Lock()
+	cancel := t.cancelFunc
+	t.mu.Unlock()
+	if cancel != nil {
+		cancel()
+	}
+}
+
+// Stats reports the execution's progress so far.
+func (t *TwapExecution) Stats() Stats {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var avg float64
+	if t.filled > 0 {
+		avg = t.filledNotional / t.filled
+	}
+	return Stats{
+		FilledQuantity:    t.filled,
+		AveragePrice:      avg,
+		RemainingQuantity: t.remainingLocked(),
+	}
+}
+
+func (t *TwapExecution) tick(ctx context.Context) error {
+	_, bids, asks := t.Conn.OrderBookSnapshot()
+	if len(bids) == 0 || len(asks) == 0 {
+		return errors.New("twap: empty order book")
+	}
+
+	topPrice := bids[0].Price
+	if t.Side == Sell {
+		topPrice = asks[0].Price
+	}
+
+	if t.PriceLimit > 0 {
+		if t.Side == Buy && topPrice > t.PriceLimit {
+			return nil
+		}
+		if t.Side == Sell && topPrice < t.PriceLimit {
+			return nil
+		}
+	}
+
+	t.mu.Lock()
+	activeOrderID := t.activeOrderID
+	activePrice := t.activePrice
+	remaining := t.remainingLocked()
+	t.mu.Unlock()
+
+	if remaining <= 0 {
+		return nil
+	}
+
+	if activeOrderID != "" && math.Abs(topPrice-activePrice) <= t.RepegTicks*t.tickSize() {
+		// Close enough to the top of book; leave the order resting.
+		return nil
+	}
+
+	if activeOrderID != "" {
+		cancelErr := t.cancelOrder(ctx, activeOrderID)
+
+		t.mu.Lock()
+		// onOrderDeleted may have already raced in and cleared
+		// t.activeOrderID if the order filled or was cancelled out from
+		// under us before StopOrder's response arrived — the common
+		// case StopOrder errors on. Only treat the order as gone when
+		// that's actually happened, or the cancel itself succeeded; an
+		// error with the ID still in place means a real failure
+		// (network, rate limit), and the order may still be resting, so
+		// it must not be cleared and a replacement must not be posted
+		// on top of it.
+		gone := cancelErr == nil || t.activeOrderID != activeOrderID
+		if gone {
+			t.activeOrderID = ""
+		}
+		t.mu.Unlock()
+
+		if cancelErr != nil {
+			log.Printf("bitx-go/streaming/twap: cancel failed for order %s symbol=%s: %+v", activeOrderID, t.Symbol, cancelErr)
+			if !gone {
+				// Real failure, order may still be live: don't post a
+				// replacement on top of it. Retry the cancel next tick.
+				return nil
+			}
+		}
+	}
+
+	sliceQuantity := t.SliceQuantity
+	if sliceQuantity > remaining {
+		sliceQuantity = remaining
+	}
+
+	orderID, err := t.postOrder(ctx, topPrice, sliceQuantity)
+	if err != nil {
+		return err
+	}
+
+	t.mu.Lock()
+	t.activeOrderID = orderID
+	t.activePrice = topPrice
+	t.mu.Unlock()
+
+	return nil
+}
+
+func (t *TwapExecution) postOrder(ctx context.Context, price, volume float64) (string, error) {
+	if err := t.Limiter.Wait(ctx); err != nil {
+		return "", err
+	}
+
+	orderType := bitx.ASK
+	if t.Side == Buy {
+		orderType = bitx.BID
+	}
+
+	resp, err := t.Client.PostOrder(&bitx.PostOrderRequest{
+		Pair:   t.Symbol,
+		Type:   orderType,
+		Price:  price,
+		Volume: volume,
+	})
+	if err != nil {
+		return "", err
+	}
+	return resp.OrderID, nil
+}
+
+func (t *TwapExecution) cancelOrder(ctx context.Context, orderID string) error {
+	if err := t.Limiter.Wait(ctx); err != nil {
+		return err
+	}
+
+	_, err := t.Client.StopOrder(&bitx.StopOrderRequest{OrderID: orderID})
+	return err
+}
+
+func (t *TwapExecution) cancelOutstanding() {
+	t.mu.Lock()
+	orderID := t.activeOrderID
+	t.activeOrderID = ""
+	t.mu.Unlock()
+
+	if orderID == "" {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := t.cancelOrder(ctx, orderID); err != nil {
+		log.Printf("bitx-go/streaming/twap: failed to cancel outstanding order %s symbol=%s: %+v", orderID, t.Symbol, err)
+	}
+}
+
+func (t *TwapExecution) onTradeApplied(orderID string, price, base float64, isBuy bool, timestamp time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if orderID != t.activeOrderID {
+		return
+	}
+	t.filled += base
+	t.filledNotional += price * base
+}
+
+func (t *TwapExecution) onOrderDeleted(orderID string, price, volume float64, orderType bitx.OrderType, timestamp time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if orderID == t.activeOrderID {
+		t.activeOrderID = ""
+		t.activePrice = 0
+	}
+}
+
+func (t *TwapExecution) remainingLocked() float64 {
+	r := t.TargetQuantity - t.filled
+	if r < 0 {
+		return 0
+	}
+	return r
+}
+
+func (t *TwapExecution) isComplete() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.remainingLocked() <= 0
+}
+
+func (t *TwapExecution) updateInterval() time.Duration {
+	if t.UpdateInterval > 0 {
+		return t.UpdateInterval
+	}
+	return DefaultUpdateInterval
+}
+
+func (t *TwapExecution) tickSize() float64 {
+	if t.TickSize > 0 {
+		return t.TickSize
+	}
+	return DefaultTickSize
+}
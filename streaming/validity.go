@@ -0,0 +1,97 @@
+package streaming
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+)
+
+// DefaultVerifyInterval is the default VerifyInterval used by NewConn.
+const DefaultVerifyInterval = 30 * time.Second
+
+// IsValid reports whether the maintained order book currently satisfies
+// basic structural invariants: the book is not crossed, neither side
+// carries a non-positive volume, both sides are correctly ordered, and
+// neither side is empty once the book has been initialized.
+func (c *Conn) IsValid() (bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.isValidLocked()
+}
+
+func (c *Conn) isValidLocked() (bool, error) {
+	if c.seq == 0 {
+		// Book not initialized yet; nothing to check.
+		return true, nil
+	}
+
+	bids := flatten(combineLevels(c.bids, c.bidBaseline), true)
+	asks := flatten(combineLevels(c.asks, c.askBaseline), false)
+
+	if len(bids) == 0 {
+		return false, errors.New("bitx-go/streaming: bids are empty")
+	}
+	if len(asks) == 0 {
+		return false, errors.New("bitx-go/streaming: asks are empty")
+	}
+
+	for _, e := range bids {
+		if e.Volume <= 0 {
+			return false, fmt.Errorf("bitx-go/streaming: non-positive bid volume %f", e.Volume)
+		}
+	}
+	for _, e := range asks {
+		if e.Volume <= 0 {
+			return false, fmt.Errorf("bitx-go/streaming: non-positive ask volume %f", e.Volume)
+		}
+	}
+	if !sort.IsSorted(sort.Reverse(orderList(bids))) {
+		return false, errors.New("bitx-go/streaming: bids are not in descending price order")
+	}
+	if !sort.IsSorted(orderList(asks)) {
+		return false, errors.New("bitx-go/streaming: asks are not in ascending price order")
+	}
+	if len(bids) > 0 && len(asks) > 0 && bids[0].Price >= asks[0].Price {
+		return false, fmt.Errorf("bitx-go/streaming: crossed book: best bid %f >= best ask %f", bids[0].Price, asks[0].Price)
+	}
+
+	if c.VerifyChecksum != nil {
+		if err := c.VerifyChecksum(bids, asks, c.seq); err != nil {
+			return false, fmt.Errorf("bitx-go/streaming: checksum verification failed: %w", err)
+		}
+	}
+
+	return true, nil
+}
+
+func (c *Conn) verifyInterval() time.Duration {
+	if c.VerifyInterval > 0 {
+		return c.VerifyInterval
+	}
+	return DefaultVerifyInterval
+}
+
+// verifyLoop periodically checks the maintained book for corruption and,
+// if found, forces a resync so the book is rebuilt from a fresh snapshot.
+// Until that snapshot is applied, OrderBookSnapshot still returns the
+// current book. It exits once ws is no longer the Conn's active socket.
+func (c *Conn) verifyLoop(ws WSConn) {
+	ticker := time.NewTicker(c.verifyInterval())
+	defer ticker.Stop()
+
+	for range ticker.C {
+		c.mu.Lock()
+		if c.ws != ws {
+			c.mu.Unlock()
+			return
+		}
+
+		if valid, err := c.isValidLocked(); !valid && !c.resyncing {
+			log.Printf("bitx-go/streaming: order book invalid key=%s pair=%s: %+v, forcing resync", c.keyID, c.pair, err)
+			c.startResync()
+		}
+		c.mu.Unlock()
+	}
+}